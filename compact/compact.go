@@ -0,0 +1,282 @@
+// Package compact implements a Hatanaka-style differential encoding for
+// RINEX 3 observation data, so multi-hour logs can be shipped as compact
+// RINEX (.crx) instead of the much larger plain .obs text.
+//
+// For every satellite/observation slot the encoder keeps an Nth-order
+// (default Order) running difference of the integer-scaled observable.
+// The first epoch of an arc emits the full scaled value prefixed with
+// "&<order>"; every later epoch in the same arc emits only the
+// order-th forward difference. A missing value resets the arc, since a
+// difference can't be taken across a gap. LLI and SSI flags are
+// differenced the same way, in their own streams.
+package compact
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultOrder is the difference order used when a writer isn't given an
+// explicit one.
+const DefaultOrder = 3
+
+// Scale factors applied before integer differencing: phase is scaled by
+// 1e5, and code/Doppler/SNR by 1e3, matching the precision those
+// observables are already printed with in the plain .obs body.
+const (
+	ScalePhase = 1e5
+	ScaleOther = 1e3
+)
+
+// arc tracks the Nth-order forward-difference state for a single
+// observation slot across consecutive epochs. filled counts epochs seen
+// since the last reset, capped at order+1; until it reaches order, the
+// emitted difference is of a correspondingly lower order (order 0 on the
+// first epoch of an arc, i.e. the raw value).
+type arc struct {
+	order  int
+	prev   []int64
+	filled int
+}
+
+func newArc(order int) *arc {
+	return &arc{order: order, prev: make([]int64, order+1)}
+}
+
+// reset starts a new arc; the next encode/decode call will be treated as
+// the arc's first epoch.
+func (a *arc) reset() {
+	a.filled = 0
+	for i := range a.prev {
+		a.prev[i] = 0
+	}
+}
+
+// effectiveOrder returns the difference order to use for the next
+// encode/decode call, which ramps up from 0 until filled reaches order.
+func (a *arc) effectiveOrder() int {
+	if a.filled < a.order {
+		return a.filled
+	}
+	return a.order
+}
+
+// encode returns the token to emit for raw, and whether this is the
+// first epoch of the current arc (callers prefix first-of-arc tokens
+// with "&<order>").
+func (a *arc) encode(raw int64) (tok int64, first bool) {
+	first = a.filled == 0
+	k := a.effectiveOrder()
+	cur := make([]int64, a.order+1)
+	cur[0] = raw
+	for i := 1; i <= k; i++ {
+		cur[i] = cur[i-1] - a.prev[i-1]
+	}
+	a.prev = cur
+	if a.filled <= a.order {
+		a.filled++
+	}
+	return cur[k], first
+}
+
+// decode is the inverse of encode: given the token emitted for the next
+// epoch in the arc, it reconstructs and returns the raw value.
+func (a *arc) decode(tok int64) int64 {
+	k := a.effectiveOrder()
+	cur := make([]int64, a.order+1)
+	cur[k] = tok
+	for i := k; i >= 1; i-- {
+		cur[i-1] = cur[i] + a.prev[i-1]
+	}
+	a.prev = cur
+	if a.filled <= a.order {
+		a.filled++
+	}
+	return cur[0]
+}
+
+// Obs is one (value, LLI, SSI) triple for a single observation slot at
+// one epoch. Value is math.NaN() when the observation is absent, which
+// resets that slot's arc.
+type Obs struct {
+	Value float64
+	LLI   int
+	SSI   int
+}
+
+// SatObs is one satellite's observations for an epoch, in the same
+// band/observable order the RINEX header's SYS/#/OBS TYPES line
+// declares for that system.
+type SatObs struct {
+	ID  string // e.g. "G01"
+	Obs []Obs
+}
+
+func scaleFor(slot int) float64 {
+	// Slots are laid out C,L,D,S per band (see measPrefixes in the main
+	// package); phase is the 2nd of every group of 4.
+	if slot%4 == 1 {
+		return ScalePhase
+	}
+	return ScaleOther
+}
+
+// Writer emits a compact RINEX body: one difference stream per
+// observation slot per satellite, plus satellite-list and epoch-time
+// streams, in the text framing documented at the package level.
+type Writer struct {
+	w        *bufio.Writer
+	order    int
+	values   map[string]*arc
+	lli      map[string]*arc
+	ssi      map[string]*arc
+	prevSats []string
+	haveTime bool
+	prevSec  int64
+}
+
+// NewWriter returns a Writer with the given difference order (DefaultOrder
+// if order <= 0).
+func NewWriter(w io.Writer, order int) *Writer {
+	if order <= 0 {
+		order = DefaultOrder
+	}
+	return &Writer{
+		w:      bufio.NewWriter(w),
+		order:  order,
+		values: map[string]*arc{},
+		lli:    map[string]*arc{},
+		ssi:    map[string]*arc{},
+	}
+}
+
+func (cw *Writer) arcFor(m map[string]*arc, key string) *arc {
+	a, ok := m[key]
+	if !ok {
+		a = newArc(cw.order)
+		m[key] = a
+	}
+	return a
+}
+
+// WriteEpoch appends one epoch to the compact stream. epochSec is the
+// epoch timestamp as whole seconds since an arbitrary fixed point (the
+// caller decides the base, e.g. Unix seconds); only the delta between
+// consecutive epochs is ever written.
+func (cw *Writer) WriteEpoch(epochSec int64, sats []SatObs) error {
+	if err := cw.writeEpochLine(epochSec, len(sats)); err != nil {
+		return err
+	}
+	if err := cw.writeSatDeltas(sats); err != nil {
+		return err
+	}
+
+	for _, s := range sats {
+		var b strings.Builder
+		b.WriteString(s.ID)
+		for slot, o := range s.Obs {
+			key := s.ID + ":" + strconv.Itoa(slot)
+			valArc := cw.arcFor(cw.values, key)
+			lliArc := cw.arcFor(cw.lli, key)
+			ssiArc := cw.arcFor(cw.ssi, key)
+
+			if math.IsNaN(o.Value) {
+				valArc.reset()
+				lliArc.reset()
+				ssiArc.reset()
+				b.WriteString(" ")
+				continue
+			}
+
+			scaled := int64(math.Round(o.Value * scaleFor(slot)))
+			tok, first := valArc.encode(scaled)
+			if first {
+				fmt.Fprintf(&b, " &%d%d", cw.order, tok)
+			} else {
+				fmt.Fprintf(&b, " %d", tok)
+			}
+
+			lliTok, _ := lliArc.encode(int64(o.LLI))
+			ssiTok, _ := ssiArc.encode(int64(o.SSI))
+			fmt.Fprintf(&b, "/%d/%d", lliTok, ssiTok)
+		}
+		if _, err := fmt.Fprintln(cw.w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cw *Writer) writeEpochLine(epochSec int64, numSats int) error {
+	if !cw.haveTime {
+		cw.haveTime = true
+		cw.prevSec = epochSec
+		_, err := fmt.Fprintf(cw.w, "> &%d%d %d\n", cw.order, epochSec, numSats)
+		return err
+	}
+	delta := epochSec - cw.prevSec
+	cw.prevSec = epochSec
+	_, err := fmt.Fprintf(cw.w, "> %d %d\n", delta, numSats)
+	return err
+}
+
+// writeSatDeltas emits the satellite list only when it changed since the
+// previous epoch, as "+PRN"/"-PRN" tokens; an unchanged list emits a bare
+// "=" line.
+func (cw *Writer) writeSatDeltas(sats []SatObs) error {
+	cur := make([]string, len(sats))
+	for i, s := range sats {
+		cur[i] = s.ID
+	}
+
+	added, removed := diffSatSets(cw.prevSats, cur)
+	cw.prevSats = cur
+
+	if len(added) == 0 && len(removed) == 0 && cw.prevSats != nil {
+		_, err := fmt.Fprintln(cw.w, "=")
+		return err
+	}
+
+	var b strings.Builder
+	for _, id := range removed {
+		fmt.Fprintf(&b, "-%s ", id)
+	}
+	for _, id := range added {
+		fmt.Fprintf(&b, "+%s ", id)
+	}
+	_, err := fmt.Fprintln(cw.w, strings.TrimRight(b.String(), " "))
+	return err
+}
+
+func diffSatSets(prev, cur []string) (added, removed []string) {
+	prevSet := make(map[string]struct{}, len(prev))
+	for _, id := range prev {
+		prevSet[id] = struct{}{}
+	}
+	curSet := make(map[string]struct{}, len(cur))
+	for _, id := range cur {
+		curSet[id] = struct{}{}
+	}
+
+	for _, id := range cur {
+		if _, ok := prevSet[id]; !ok {
+			added = append(added, id)
+		}
+	}
+	for _, id := range prev {
+		if _, ok := curSet[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// Flush flushes any buffered output to the underlying writer.
+func (cw *Writer) Flush() error { return cw.w.Flush() }
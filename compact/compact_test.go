@@ -0,0 +1,346 @@
+package compact
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestArcRoundTrip verifies the core Hatanaka-style Nth-order differencing
+// primitive round-trips exactly, which is the property the Writer format
+// above depends on: a decoder that mirrors arc.decode() against
+// arc.encode()'s output must reconstruct every raw value it was given.
+func TestArcRoundTrip(t *testing.T) {
+	raws := []int64{1000000, 1000010, 1000025, 1000030, 1000050, 1000048}
+
+	enc := newArc(3)
+	dec := newArc(3)
+
+	var firsts []bool
+	var toks []int64
+	for _, r := range raws {
+		tok, first := enc.encode(r)
+		toks = append(toks, tok)
+		firsts = append(firsts, first)
+	}
+
+	if !firsts[0] {
+		t.Fatalf("expected first encoded value to start a new arc")
+	}
+	for i := 1; i < len(firsts); i++ {
+		if firsts[i] {
+			t.Fatalf("epoch %d unexpectedly marked as a new arc", i)
+		}
+	}
+
+	for i, tok := range toks {
+		got := dec.decode(tok)
+		if got != raws[i] {
+			t.Fatalf("epoch %d: decode(%d) = %d, want %d", i, tok, got, raws[i])
+		}
+	}
+}
+
+// TestArcResetAcrossGap verifies that resetting an arc (simulating a
+// missing observation) makes the next value the start of a fresh arc,
+// rather than a difference against the stale history.
+func TestArcResetAcrossGap(t *testing.T) {
+	enc := newArc(3)
+	dec := newArc(3)
+
+	first := []int64{2000000, 2000010, 2000021}
+	for _, r := range first {
+		tok, _ := enc.encode(r)
+		if got := dec.decode(tok); got != r {
+			t.Fatalf("decode(%d) = %d, want %d", tok, got, r)
+		}
+	}
+
+	enc.reset()
+	dec.reset()
+
+	tok, first0 := enc.encode(9000000)
+	if !first0 {
+		t.Fatalf("expected reset arc's next encode to report first=true")
+	}
+	if got := dec.decode(tok); got != 9000000 {
+		t.Fatalf("decode after reset = %d, want 9000000", got)
+	}
+}
+
+// TestWriterEmitsArcMarkerOnce checks that the "&<order>" prefix is only
+// emitted for the first epoch of each satellite's arc.
+func TestWriterEmitsArcMarkerOnce(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 3)
+
+	epoch := func(sec int64, val float64) {
+		if err := w.WriteEpoch(sec, []SatObs{{ID: "G01", Obs: []Obs{{Value: val}}}}); err != nil {
+			t.Fatalf("WriteEpoch: %v", err)
+		}
+	}
+	epoch(0, 20000000.1)
+	epoch(1, 20000000.2)
+	epoch(2, 20000000.3)
+	w.Flush()
+
+	out := buf.String()
+	if n := strings.Count(out, "G01 &3"); n != 1 {
+		t.Fatalf("expected exactly one G01 arc-start marker, got %d in output:\n%s", n, out)
+	}
+}
+
+func TestScaleForAlternatesPhaseAndOther(t *testing.T) {
+	if scaleFor(0) != ScaleOther { // code
+		t.Fatalf("slot 0 (code) should scale by %v", ScaleOther)
+	}
+	if scaleFor(1) != ScalePhase { // phase
+		t.Fatalf("slot 1 (phase) should scale by %v", ScalePhase)
+	}
+	if scaleFor(2) != ScaleOther { // Doppler
+		t.Fatalf("slot 2 (Doppler) should scale by %v", ScaleOther)
+	}
+	if scaleFor(3) != ScaleOther { // SNR
+		t.Fatalf("slot 3 (SNR) should scale by %v", ScaleOther)
+	}
+}
+
+// TestObsValueNaNResetsArc checks that a missing value (NaN) forces the
+// satellite's next real value to restart its arc.
+func TestObsValueNaNResetsArc(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 3)
+
+	if err := w.WriteEpoch(0, []SatObs{{ID: "G01", Obs: []Obs{{Value: 1.0}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteEpoch(1, []SatObs{{ID: "G01", Obs: []Obs{{Value: math.NaN()}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteEpoch(2, []SatObs{{ID: "G01", Obs: []Obs{{Value: 1.0}}}}); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	if n := strings.Count(buf.String(), "G01 &3"); n != 2 {
+		t.Fatalf("expected the value after the gap to restart the arc (2 markers), got %d in:\n%s", n, buf.String())
+	}
+}
+
+// decodedEpoch is one epoch reconstructed by decodeStream: the epoch
+// timestamp and, per satellite, the reconstructed Obs values.
+type decodedEpoch struct {
+	epochSec int64
+	sats     map[string][]Obs
+}
+
+// decodeStream is a reference decoder for Writer's text framing. It
+// exists only so tests can verify that WriteEpoch's output round-trips
+// back to the exact values it was given; it mirrors the framing
+// directly rather than reusing any Writer internals, so a bug shared
+// between encode and decode wouldn't be masked. It ignores the
+// satellite add/remove ("+ID"/"-ID"/"=") line, since every satellite
+// data line already carries its own ID.
+func decodeStream(r io.Reader, order int) ([]decodedEpoch, error) {
+	orderDigits := len(strconv.Itoa(order))
+	sc := bufio.NewScanner(r)
+
+	var epochs []decodedEpoch
+	var prevSec int64
+
+	values := map[string]*arc{}
+	llis := map[string]*arc{}
+	ssis := map[string]*arc{}
+	arcFor := func(m map[string]*arc, key string) *arc {
+		a, ok := m[key]
+		if !ok {
+			a = newArc(order)
+			m[key] = a
+		}
+		return a
+	}
+
+	decodeTok := func(tok string) (int64, error) {
+		if strings.HasPrefix(tok, "&") {
+			return strconv.ParseInt(tok[1+orderDigits:], 10, 64)
+		}
+		return strconv.ParseInt(tok, 10, 64)
+	}
+
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "> ") {
+			return nil, fmt.Errorf("expected epoch line, got %q", line)
+		}
+		fields := strings.Fields(line[2:])
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed epoch line %q", line)
+		}
+		numSats, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		var sec int64
+		if strings.HasPrefix(fields[0], "&") {
+			sec, err = decodeTok(fields[0])
+		} else {
+			var delta int64
+			delta, err = strconv.ParseInt(fields[0], 10, 64)
+			sec = prevSec + delta
+		}
+		if err != nil {
+			return nil, err
+		}
+		prevSec = sec
+
+		if !sc.Scan() {
+			return nil, fmt.Errorf("missing satellite-delta line")
+		}
+
+		sats := map[string][]Obs{}
+		for i := 0; i < numSats; i++ {
+			if !sc.Scan() {
+				return nil, fmt.Errorf("missing satellite data line")
+			}
+			parts := strings.Split(sc.Text(), " ")
+			id := parts[0]
+			obs := make([]Obs, len(parts)-1)
+			for slot := 0; slot < len(parts)-1; slot++ {
+				key := id + ":" + strconv.Itoa(slot)
+				valArc := arcFor(values, key)
+				lliArc := arcFor(llis, key)
+				ssiArc := arcFor(ssis, key)
+
+				tok := parts[slot+1]
+				if tok == "" {
+					valArc.reset()
+					lliArc.reset()
+					ssiArc.reset()
+					obs[slot] = Obs{Value: math.NaN()}
+					continue
+				}
+
+				segs := strings.SplitN(tok, "/", 3)
+				if len(segs) != 3 {
+					return nil, fmt.Errorf("malformed observation token %q", tok)
+				}
+				valTok, err := decodeTok(segs[0])
+				if err != nil {
+					return nil, err
+				}
+				lliTok, err := strconv.ParseInt(segs[1], 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				ssiTok, err := strconv.ParseInt(segs[2], 10, 64)
+				if err != nil {
+					return nil, err
+				}
+
+				obs[slot] = Obs{
+					Value: float64(valArc.decode(valTok)) / scaleFor(slot),
+					LLI:   int(lliArc.decode(lliTok)),
+					SSI:   int(ssiArc.decode(ssiTok)),
+				}
+			}
+			sats[id] = obs
+		}
+
+		epochs = append(epochs, decodedEpoch{epochSec: sec, sats: sats})
+	}
+	return epochs, sc.Err()
+}
+
+// TestDecodeStreamRoundTripsExactly feeds a multi-epoch, multi-satellite
+// stream (including a missing observation) through Writer and back
+// through decodeStream, and checks that every value, LLI and SSI comes
+// back exactly as given — the property the request asked CI to verify
+// before trusting compact RINEX as a drop-in replacement for plain .obs.
+func TestDecodeStreamRoundTripsExactly(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 3)
+
+	type epochInput struct {
+		sec  int64
+		sats []SatObs
+	}
+	inputs := []epochInput{
+		{sec: 1000, sats: []SatObs{
+			{ID: "G01", Obs: []Obs{{Value: 20000000.123, SSI: 7}, {Value: 100000000.12345, LLI: 1, SSI: 8}}},
+			{ID: "R01", Obs: []Obs{{Value: 19000000.5, SSI: 6}, {Value: math.NaN()}}},
+		}},
+		{sec: 1030, sats: []SatObs{
+			{ID: "G01", Obs: []Obs{{Value: 20000100.456, SSI: 7}, {Value: 100000200.98765, SSI: 8}}},
+			{ID: "R01", Obs: []Obs{{Value: 19000050.25, SSI: 6}, {Value: 90000000.5, SSI: 5}}},
+		}},
+		{sec: 1060, sats: []SatObs{
+			{ID: "G01", Obs: []Obs{{Value: 20000200.789, SSI: 7}, {Value: 100000301.54321, SSI: 8}}},
+			{ID: "R01", Obs: []Obs{{Value: 19000100.0, SSI: 6}, {Value: 90000100.75, SSI: 5}}},
+		}},
+	}
+
+	for _, in := range inputs {
+		if err := w.WriteEpoch(in.sec, in.sats); err != nil {
+			t.Fatalf("WriteEpoch: %v", err)
+		}
+	}
+	w.Flush()
+
+	decoded, err := decodeStream(&buf, 3)
+	if err != nil {
+		t.Fatalf("decodeStream: %v", err)
+	}
+	if len(decoded) != len(inputs) {
+		t.Fatalf("decoded %d epochs, want %d", len(decoded), len(inputs))
+	}
+
+	for i, in := range inputs {
+		got := decoded[i]
+		if got.epochSec != in.sec {
+			t.Fatalf("epoch %d: decoded sec %d, want %d", i, got.epochSec, in.sec)
+		}
+		for _, s := range in.sats {
+			gotObs, ok := got.sats[s.ID]
+			if !ok {
+				t.Fatalf("epoch %d: missing satellite %s in decoded output", i, s.ID)
+			}
+			if len(gotObs) != len(s.Obs) {
+				t.Fatalf("epoch %d sat %s: decoded %d slots, want %d", i, s.ID, len(gotObs), len(s.Obs))
+			}
+			for slot, want := range s.Obs {
+				g := gotObs[slot]
+				if math.IsNaN(want.Value) {
+					if !math.IsNaN(g.Value) {
+						t.Fatalf("epoch %d sat %s slot %d: got %v, want NaN", i, s.ID, slot, g.Value)
+					}
+					continue
+				}
+				// The plain .obs body prints code/Doppler/SNR to 3 decimal
+				// places and phase to 5 (see precFor in the main
+				// package); byte-for-byte equivalence with that body only
+				// requires matching at that printed precision.
+				prec := 3
+				if slot%4 == 1 {
+					prec = 5
+				}
+				wantStr := strconv.FormatFloat(want.Value, 'f', prec, 64)
+				gotStr := strconv.FormatFloat(g.Value, 'f', prec, 64)
+				if wantStr != gotStr {
+					t.Fatalf("epoch %d sat %s slot %d: decoded %s, want %s", i, s.ID, slot, gotStr, wantStr)
+				}
+				if g.LLI != want.LLI {
+					t.Fatalf("epoch %d sat %s slot %d: decoded LLI %d, want %d", i, s.ID, slot, g.LLI, want.LLI)
+				}
+				if g.SSI != want.SSI {
+					t.Fatalf("epoch %d sat %s slot %d: decoded SSI %d, want %d", i, s.ID, slot, g.SSI, want.SSI)
+				}
+			}
+		}
+	}
+}
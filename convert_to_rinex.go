@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
+	"compress/gzip"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"math"
@@ -12,11 +14,42 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/tsmith-vs/gnss-json-to-rinex3/compact"
+	"github.com/tsmith-vs/gnss-json-to-rinex3/nav"
+	"github.com/tsmith-vs/gnss-json-to-rinex3/profile"
 )
 
 var (
-	// epochs maps a timestamp -> a row (field -> value) for that timestamp
-	epochs map[string]map[string]any
+	// fieldValues holds the decoded array for every field createEpochs
+	// eagerly keeps: recordTime's own parsing aside, that's each VS<sys>
+	// array, gloFrq, and the flat eph_*/iono_*/clk_* ephemeris fields —
+	// always small relative to file size. When writeBody's plain-.obs path
+	// is in play, the large per-band code_*/phase_*/doppler_*/snr_*/
+	// lli_*/ssi_* arrays are deliberately left out of fieldValues; see
+	// scanFields. writeCompactBody still needs them all resident (compact
+	// encoding carries per-satellite state across epochs that doesn't fit
+	// the group/temp-file scheme below), so createEpochs decodes
+	// everything eagerly, as before, whenever --compact is requested.
+	fieldValues map[string][]any
+
+	// recordTimes[i] is the timestamp string for epoch position i, aligned
+	// with every slice in fieldValues.
+	recordTimes []string
+
+	// epochOrder lists epoch positions (indexes into recordTimes /
+	// fieldValues) sorted by timestamp, computed once right after decoding.
+	epochOrder []int
+
+	// activeProfile declares the signal plan (bands, obs codes, JSON field
+	// prefixes) in effect for this run; set once in main from --profile or
+	// profile.Default().
+	activeProfile profile.Profile
+
+	// sourcePath is the observation JSON file createEpochs decoded, kept
+	// around so writeBody's group passes (see scanFields) can reopen it to
+	// read the per-band fields createEpochs skipped.
+	sourcePath string
 )
 
 // ----- small helpers -----
@@ -52,13 +85,16 @@ func parseEpoch(s string) (time.Time, error) {
 	return time.ParseInLocation(layout, strings.TrimSpace(s), time.UTC)
 }
 
-func sortedEpochKeys() []string {
-	keys := make([]string, 0, len(epochs))
-	for k := range epochs {
-		keys = append(keys, k)
+// buildEpochOrder sorts epoch positions by their timestamp string. The
+// "2006-01-02 15:04:05" layout sorts correctly lexicographically, so a
+// plain string sort (as the old map-key sort did) is sufficient.
+func buildEpochOrder(times []string) []int {
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
 	}
-	sort.Strings(keys)
-	return keys
+	sort.Slice(order, func(a, b int) bool { return times[order[a]] < times[order[b]] })
+	return order
 }
 
 func estimateInterval(sortedKeys []string) float64 {
@@ -122,20 +158,6 @@ func formatSysObsTypesLines(sys rune, types []string) string {
 	return sb.String()
 }
 
-// Build the exact observation type lists you requested.
-// Order is C, L, D, S per band, and bands are the ones you specified.
-func fixedSysObsTypes() map[rune][]string {
-	return map[rune][]string{
-		'G': {"C1C", "L1C", "D1C", "S1C", "C2C", "L2C", "D2C", "S2C"},
-		'R': {"C1C", "L1C", "D1C", "S1C", "C2C", "L2C", "D2C", "S2C"},
-		'E': {"C1X", "L1X", "D1X", "S1X", "C7X", "L7X", "D7X", "S7X"},
-		// B is printed as C (BeiDou), with bands 2 and 7 using X attribute:
-		'C': {"C2X", "L2X", "D2X", "S2X", "C7X", "L7X", "D7X", "S7X"},
-		// Q is printed as J (QZSS), with 1 and 2 (L2X attribute by your sample):
-		'J': {"C1C", "L1C", "D1C", "S1C", "C2X", "L2X", "D2X", "S2X"},
-	}
-}
-
 // --- GLONASS SLOT / FRQ # section ---
 // slots is a map: PRN -> frequency channel (e.g., 1:-7..+6)
 // Lines carry up to 8 pairs per line, matching typical practice.
@@ -210,24 +232,120 @@ func formatSysPhaseShiftLines(shifts map[rune]map[string]float64) string {
 	return sb.String()
 }
 
-// The header using fixed SYS/OBS_TYPES and dynamic first/last and interval.
-func getHeaderFixed() (string, error) {
-	if len(epochs) == 0 {
-		return "", fmt.Errorf("no epochs available")
+// formatGlonassCodPhsBisLine builds the GLONASS COD/PHS/BIS header line.
+// This tool doesn't derive per-receiver GLONASS code/phase biases from
+// the JSON dump, so it reports the four standard observable codes with
+// zero bias, matching RINEX 3's "none applied" convention.
+func formatGlonassCodPhsBisLine() string {
+	body := fmt.Sprintf(" %-3s %8.3f %-3s %8.3f %-3s %8.3f %-3s %8.3f",
+		"C1C", 0.0, "C1P", 0.0, "C2C", 0.0, "C2P", 0.0)
+	return headerLine(body, "GLONASS COD/PHS/BIS")
+}
+
+// glonassChannels scans every epoch's VSR and gloFrq arrays (the latter
+// aligned with VSR by satellite index) and returns a PRN -> frequency
+// channel map. Epochs are visited in recordTime order and a PRN's last
+// non-zero channel wins, so an epoch missing or zeroing out gloFrq
+// doesn't erase a channel reported earlier.
+func glonassChannels() map[int]int {
+	channels := map[int]int{}
+	vsKey := vsKeyFor("R")
+	if vsKey == "" {
+		return channels
+	}
+	for _, idx := range epochOrder {
+		prns, ok := epochSlice(vsKey, idx)
+		if !ok {
+			continue
+		}
+		frq, ok := epochSlice("gloFrq", idx)
+		if !ok {
+			continue
+		}
+		for j, v := range prns {
+			prn, ok := toInt(v)
+			if !ok || prn <= 0 || j >= len(frq) {
+				continue
+			}
+			ch, ok := toInt(frq[j])
+			if !ok || ch == 0 {
+				continue
+			}
+			channels[prn] = ch
+		}
+	}
+	return channels
+}
+
+// hasGlonassObs reports whether any epoch carries a GLONASS observation
+// (a positive PRN in the VSR array), independent of whether gloFrq
+// channel data is present. RINEX 3.04 requires the GLONASS COD/PHS/BIS
+// header line whenever GLONASS observations are present, regardless of
+// whether a channel map could be derived.
+func hasGlonassObs() bool {
+	vsKey := vsKeyFor("R")
+	if vsKey == "" {
+		return false
+	}
+	for _, idx := range epochOrder {
+		prns, ok := epochSlice(vsKey, idx)
+		if !ok {
+			continue
+		}
+		for _, v := range prns {
+			if prn, ok := toInt(v); ok && prn > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseGlonassSlots parses a --glonass-slots value like "R01=1,R02=-4"
+// into a PRN -> channel map, for overriding whatever this tool derived
+// from gloFrq.
+func parseGlonassSlots(s string) (map[int]int, error) {
+	slots := map[int]int{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid --glonass-slots entry %q: want RNN=channel", part)
+		}
+		prn, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(kv[0]), "R"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --glonass-slots PRN %q: %w", kv[0], err)
+		}
+		ch, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --glonass-slots channel %q: %w", kv[1], err)
+		}
+		slots[prn] = ch
 	}
-	keys := sortedEpochKeys()
-	firstTS, err := parseEpoch(keys[0])
+	return slots, nil
+}
+
+// The header using the active profile's SYS/OBS_TYPES and dynamic
+// first/last and interval. first, last and intervalSec are derived from
+// recordTimes/epochOrder, which createEpochs already holds in memory, so
+// no extra pass over the file is needed. glonassSlots maps GLONASS PRN ->
+// frequency channel (see glonassChannels and parseGlonassSlots); the
+// GLONASS SLOT / FRQ # line is only emitted when that map is non-empty,
+// since a channel can't be printed when it isn't known. GLONASS
+// COD/PHS/BIS is gated separately, on hasGlonassObs, since RINEX 3.04
+// requires it whenever GLONASS observations are present at all.
+func getHeaderFixed(first, last string, intervalSec float64, glonassSlots map[int]int) (string, error) {
+	firstTS, err := parseEpoch(first)
 	if err != nil {
-		return "", fmt.Errorf("parse first epoch %q: %w", keys[0], err)
+		return "", fmt.Errorf("parse first epoch %q: %w", first, err)
 	}
-	lastTS, err := parseEpoch(keys[len(keys)-1])
+	lastTS, err := parseEpoch(last)
 	if err != nil {
-		return "", fmt.Errorf("parse last epoch %q: %w", keys[len(keys)-1], err)
+		return "", fmt.Errorf("parse last epoch %q: %w", last, err)
 	}
-	intervalSec := estimateInterval(keys)
-
-	sysToTypes := fixedSysObsTypes()
-	orderSys := []rune{'G', 'R', 'E', 'C', 'J'}
 
 	var hdr strings.Builder
 	hdr.WriteString(headerLine("     3.04           OBSERVATION DATA    M: MIXED", "RINEX VERSION / TYPE"))
@@ -237,9 +355,10 @@ func getHeaderFixed() (string, error) {
 	))
 	hdr.WriteString(headerLine("Generated automatically from JSON observations", "COMMENT"))
 
-	for _, sys := range orderSys {
-		if types := sysToTypes[sys]; len(types) > 0 {
-			hdr.WriteString(formatSysObsTypesLines(sys, types))
+	for _, dispSys := range activeProfile.Order {
+		sysDef := activeProfile.Systems[dispSys]
+		if types := sysDef.ObsTypes(); len(types) > 0 {
+			hdr.WriteString(formatSysObsTypesLines(rune(dispSys[0]), types))
 		}
 	}
 
@@ -260,6 +379,13 @@ func getHeaderFixed() (string, error) {
 		"TIME OF LAST OBS",
 	))
 
+	if len(glonassSlots) > 0 {
+		hdr.WriteString(formatGlonassSlotFreqLines(glonassSlots))
+	}
+	if hasGlonassObs() {
+		hdr.WriteString(formatGlonassCodPhsBisLine())
+	}
+
 	hdr.WriteString(headerLine("0", "RCV CLOCK OFFS APPL"))
 	hdr.WriteString(headerLine("", "END OF HEADER"))
 
@@ -306,72 +432,254 @@ func ensureRinexDir() {
 	}
 }
 
-func createEpochs(path string) {
-	// Read the file using the full path
-	data, err := os.ReadFile(path)
+// isEphemerisKey reports whether key is one of the flat broadcast-
+// ephemeris fields (eph_*, one entry per ephemeris record) or the
+// optional iono_corr/clk_corr correction arrays — all cheap regardless of
+// file size, since none of them is nested per observation epoch.
+func isEphemerisKey(key string) bool {
+	return strings.HasPrefix(key, "eph_") || strings.HasPrefix(key, "iono_") || strings.HasPrefix(key, "clk_")
+}
+
+// eagerFieldKeys returns the JSON field names createEpochs always decodes
+// regardless of lazyBody: every VS<sys> array the active profile uses
+// (isAllVSZero reads across all of them for a given satellite index, so
+// they must all be resident together) and gloFrq (read by
+// glonassChannels/hasGlonassObs over every epoch before the header is
+// written).
+func eagerFieldKeys() map[string]bool {
+	eager := map[string]bool{"gloFrq": true}
+	for _, dispSys := range activeProfile.Order {
+		if key := vsKeyFor(dispSys); key != "" {
+			eager[key] = true
+		}
+	}
+	return eager
+}
+
+// createEpochs reads path through a json.Decoder field by field instead
+// of os.ReadFile + json.Unmarshal, so the raw file bytes and the parsed
+// value are never both resident at once. recordTime is decoded directly
+// into recordTimes (whichever key position it appears in).
+//
+// Every other field is either small enough to always keep (the VS<sys>
+// arrays, gloFrq, and the flat ephemeris fields — see eagerFieldKeys and
+// isEphemerisKey) or is one of the large per-band observable arrays
+// (code_*/phase_*/doppler_*/snr_*/lli_*/ssi_*), whose own memory cost
+// scales with file size. When lazyBody is true those large fields are
+// skipped here via skipValue rather than decoded, and writeBody instead
+// re-reads sourcePath one (system, band) group at a time through
+// scanFields, so at most one group's worth of per-band data — not the
+// whole file's — is ever resident at once. lazyBody is false only for
+// --compact runs, where writeCompactBody still needs every field held in
+// fieldValues for the run's duration.
+func createEpochs(path string, lazyBody bool) {
+	sourcePath = path
+
+	f, err := os.Open(path)
 	epanic(err)
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	dec.UseNumber()
+
+	epanic(expectDelim(dec, '{'))
+
+	fieldValues = make(map[string][]any)
+	recordTimes = nil
+	eager := eagerFieldKeys()
+
+	for dec.More() {
+		keyTok, err := dec.Token()
+		epanic(err)
+		key, ok := keyTok.(string)
+		if !ok {
+			epanic(fmt.Errorf("unexpected object key token %v in %s", keyTok, path))
+		}
+
+		if key == "recordTime" {
+			if err := dec.Decode(&recordTimes); err != nil {
+				epanic(fmt.Errorf("decode %q in %s: %w", key, path, err))
+			}
+			continue
+		}
+
+		if lazyBody && !eager[key] && !isEphemerisKey(key) {
+			epanic(skipValue(dec))
+			continue
+		}
+
+		val, err := decodeValue(dec)
+		epanic(err)
+
+		outer, ok := val.([]any)
+		if !ok {
+			// Non-array fields are constant across epochs; nothing to index.
+			continue
+		}
+		fieldValues[key] = outer
+	}
 
-	// Generic container: map[string]any
-	var content map[string]any
-	if err := json.Unmarshal(data, &content); err != nil {
-		epanic(fmt.Errorf("JSON unmarshal failed for %s: %w", path, err))
+	if _, err := dec.Token(); err != nil { // closing '}'
+		epanic(err)
 	}
 
-	// Extract recordTime as []string
-	rawRT, ok := content["recordTime"]
-	if !ok {
+	if len(recordTimes) == 0 {
 		epanic(fmt.Errorf("field %q not found in %s", "recordTime", path))
 	}
-	rtSlice, ok := rawRT.([]any)
+
+	epochOrder = buildEpochOrder(recordTimes)
+}
+
+// expectDelim consumes the next token and errors unless it is the given
+// JSON delimiter.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	d, ok := tok.(json.Delim)
+	if !ok || d != want {
+		return fmt.Errorf("expected %q, got %v", want, tok)
+	}
+	return nil
+}
+
+// decodeValue walks one JSON value token-by-token, rebuilding the same
+// map[string]any / []any / scalar shape json.Unmarshal would produce, but
+// without ever holding the raw encoded bytes or a second full copy of the
+// document alongside the decoded one.
+func decodeValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch d := tok.(type) {
+	case json.Delim:
+		switch d {
+		case '[':
+			arr := []any{}
+			for dec.More() {
+				v, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+			if _, err := dec.Token(); err != nil { // closing ']'
+				return nil, err
+			}
+			return arr, nil
+		case '{':
+			obj := map[string]any{}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, _ := keyTok.(string)
+				v, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				obj[key] = v
+			}
+			if _, err := dec.Token(); err != nil { // closing '}'
+				return nil, err
+			}
+			return obj, nil
+		default:
+			return nil, fmt.Errorf("unexpected delimiter %v", d)
+		}
+	default:
+		return tok, nil // string, json.Number, bool, or nil
+	}
+}
+
+// skipValue consumes one JSON value's tokens without allocating anything
+// to hold them, by tracking array/object nesting depth. It's decodeValue's
+// counterpart for fields createEpochs has decided not to keep.
+func skipValue(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	d, ok := tok.(json.Delim)
 	if !ok {
-		epanic(fmt.Errorf("recordTime has type %T; expected array", rawRT))
+		return nil // scalar: already consumed
+	}
+	if d != '[' && d != '{' {
+		return fmt.Errorf("unexpected delimiter %v", d)
 	}
 
-	recordTimes := make([]string, len(rtSlice))
-	for i, v := range rtSlice {
-		s, ok := v.(string)
-		if !ok {
-			epanic(fmt.Errorf("recordTime[%d] has type %T; expected string", i, v))
+	depth := 1
+	for depth > 0 {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if d, ok := tok.(json.Delim); ok {
+			switch d {
+			case '[', '{':
+				depth++
+			case ']', '}':
+				depth--
+			}
 		}
-		recordTimes[i] = s
 	}
+	return nil
+}
 
-	numEpochs := len(recordTimes)
-	epochs = make(map[string]map[string]any, numEpochs)
+// scanFields re-opens path and decodes only the top-level fields named in
+// want, skipping every other field via skipValue. It's how writeBody's
+// group passes recover the large per-band arrays createEpochs left out of
+// fieldValues when lazyBody is true, one (system, band) group at a time
+// instead of all at once.
+func scanFields(path string, want map[string]bool) (map[string][]any, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
 
-	// For every epoch index, grab the i-th element from each other field (if present)
-	for i := range numEpochs {
-		ts := recordTimes[i]
-		row := make(map[string]any)
+	dec := json.NewDecoder(bufio.NewReader(f))
+	dec.UseNumber()
 
-		for key, val := range content {
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
 
-			if key == "recordTime" {
-				// // Keep the timestamp in the row as well
-				// row[key] = recordTimes[i]
-				continue
-			}
+	out := make(map[string][]any, len(want))
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := keyTok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object key token %v in %s", keyTok, path)
+		}
 
-			// Most fields are arrays (one element per epoch).
-			// They often are [][]<something>, which unmarshal as []any (outer) of []any (inner).
-			outer, ok := val.([]any)
-			if !ok {
-				// // If a field is not an array, we can still carry it through as-is (constant across epochs).
-				// row[key] = val
-				continue
+		if !want[key] {
+			if err := skipValue(dec); err != nil {
+				return nil, err
 			}
+			continue
+		}
 
-			if i < len(outer) {
-				// The per-epoch value could be []any (e.g., a vector), or any other JSON type.
-				row[key] = outer[i]
-			} else {
-				// We’ll set an empty slice to mirror the structure.
-				row[key] = []any{}
-			}
+		val, err := decodeValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		if outer, ok := val.([]any); ok {
+			out[key] = outer
 		}
+	}
 
-		epochs[ts] = row
+	if _, err := dec.Token(); err != nil { // closing '}'
+		return nil, err
 	}
+	return out, nil
 }
 
 // Safe type helpers
@@ -405,86 +713,164 @@ func toInt(v any) (int, bool) {
 	return int(math.Round(f)), true
 }
 
-func fmtObs(val any, prec int) string {
-	if f, ok := toFloat(val); ok {
+// fmtObs formats one 14.xf observation plus its LLI and SSI flag
+// characters (blank when lli/ssi is flagAbsent). When noFlags is set it
+// drops the two flag columns entirely rather than just blanking them, so
+// --no-flags output matches the pre-flags format byte-for-byte.
+func fmtObs(val any, lli, ssi int, prec int) string {
+	f, ok := toFloat(val)
+	if noFlags {
+		if !ok {
+			return fmt.Sprintf("%14s", "")
+		}
 		return fmt.Sprintf("%14.*f", prec, f)
 	}
-	return fmt.Sprintf("%14s", "")
-}
-func precFor(prefix string) int {
-	switch prefix {
-	case "cpMes_":
-		return 5 // phase
-	case "prMes_":
-		return 3 // code
-	case "doMes_":
-		return 3 // Doppler
-	case "cn0_":
-		return 3 // SNR
-	default:
-		return 3
+	if !ok {
+		return fmt.Sprintf("%16s", "")
+	}
+	return fmt.Sprintf("%14.*f%1s%1s", prec, f, flagChar(lli), flagChar(ssi))
+}
+
+// flagAbsent marks an LLI/SSI value as not present, printed as a blank.
+const flagAbsent = -1
+
+func flagChar(v int) string {
+	if v < 0 {
+		return " "
+	}
+	return strconv.Itoa(v)
+}
+
+// ssiFromCN0 derives a 1-9 signal-strength indicator from a C/N0 value in
+// dB-Hz, per the standard RINEX 3 mapping, for JSON dumps that carry C/N0
+// but no explicit SSI.
+func ssiFromCN0(cn0 float64) int {
+	v := int(math.Floor(cn0 / 6))
+	if v < 1 {
+		v = 1
+	}
+	if v > 9 {
+		v = 9
 	}
+	return v
+}
+
+// precFor gives the decimal precision for one of the four observable
+// kinds a profile's Prefixes carries (phase is printed to 5 places,
+// everything else to 3, matching RINEX 3 convention).
+func precFor(kind string) int {
+	if kind == "phase" {
+		return 5
+	}
+	return 3
 }
 func satID(sys rune, prn int) string {
 	return fmt.Sprintf("%c%02d", sys, prn)
 }
 
-// Mapping: display system -> data system rune used in JSON suffixes
-// G->G, R->R, E->E, C->B, J->Q (B is actually C; Q is actually J)
-var displayToDataSys = map[rune]rune{
-	'G': 'G',
-	'R': 'R',
-	'E': 'E',
-	'C': 'B',
-	'J': 'Q',
-}
-
-// VS keys by display sys (mapped to underlying data sys)
-func vsKeyFor(displaySys rune) string {
-	switch displaySys {
-	case 'G':
-		return "VSG"
-	case 'R':
-		return "VSR"
-	case 'E':
-		return "VSE"
-	case 'C': // BeiDou data is under B
-		return "VSB"
-	case 'J': // QZSS data is under Q
-		return "VSQ"
+// obsKinds is the fixed print order of observable kinds within a band:
+// code, phase, Doppler, SNR.
+var obsKinds = []string{"code", "phase", "doppler", "snr"}
+
+// lliPrefix and ssiPrefix name the optional per-system-band flag arrays,
+// e.g. "lli_G1" / "ssi_G1". Unlike the C/L/D/S prefixes these aren't
+// profile-configurable: they're this tool's own convention for carrying
+// RINEX flags through the JSON, not a receiver-specific field name.
+const (
+	lliPrefix = "lli_"
+	ssiPrefix = "ssi_"
+)
+
+// noFlags, when set (via --no-flags), suppresses LLI/SSI lookup so the
+// body is emitted with blank flag columns exactly as before this feature
+// existed, for bit-for-bit backwards compatibility.
+var noFlags bool
+
+// prefixFor returns a system's JSON field-name prefix for the given
+// observable kind ("code", "phase", "doppler" or "snr").
+func prefixFor(prefixes profile.ObsPrefixes, kind string) string {
+	switch kind {
+	case "code":
+		return prefixes.Code
+	case "phase":
+		return prefixes.Phase
+	case "doppler":
+		return prefixes.Doppler
+	case "snr":
+		return prefixes.SNR
 	default:
 		return ""
 	}
 }
 
-// Bands per display system (printed order), and corresponding data suffix rune
-func bandsFor(displaySys rune) []string {
-	switch displaySys {
-	case 'G':
-		return []string{"1", "2"}
-	case 'R':
-		return []string{"1", "2"}
-	case 'E':
-		return []string{"1", "7"}
-	case 'C': // BeiDou printed as C, but data is B2/B7
-		return []string{"2", "7"}
-	case 'J': // QZSS printed as J, data is Q1/Q2
-		return []string{"1", "2"}
-	default:
-		return nil
-	}
+// bandFlags looks up satellite index j's LLI and SSI for one system/band
+// suffix (e.g. "G1") from fieldValues. See bandFlagsFrom.
+func bandFlags(idx, j int, sfx string, sysDef profile.SystemDef) (lli, ssi int) {
+	return bandFlagsFrom(fieldValues, idx, j, sfx, sysDef)
 }
 
-// Observation order per band (C,L,D,S)
-var measPrefixes = []string{"prMes_", "cpMes_", "doMes_", "cn0_"}
+// bandFlagsFrom looks up satellite index j's LLI and SSI for one
+// system/band suffix (e.g. "G1") out of source, returning flagAbsent for
+// either when --no-flags is set or the corresponding array is missing.
+// When ssi_<sfx> isn't present, SSI is derived from that band's C/N0 via
+// ssiFromCN0. source is fieldValues for writeCompactBody's eager path, or
+// one group's freshly-scanned fields for writeBody's lazy path.
+func bandFlagsFrom(source map[string][]any, idx, j int, sfx string, sysDef profile.SystemDef) (lli, ssi int) {
+	if noFlags {
+		return flagAbsent, flagAbsent
+	}
 
-// Skip rows where all VS (G,E,B,Q,R) at index j are zero
-func getVSVal(content map[string]any, key string, j int) float64 {
-	raw, ok := content[key]
+	lli = flagAbsent
+	if row, ok := epochSliceFrom(source, lliPrefix+sfx, idx); ok && j < len(row) {
+		if v, ok := toInt(row[j]); ok {
+			lli = v
+		}
+	}
+
+	ssi = flagAbsent
+	if row, ok := epochSliceFrom(source, ssiPrefix+sfx, idx); ok && j < len(row) {
+		if v, ok := toInt(row[j]); ok {
+			ssi = v
+		}
+	} else if row, ok := epochSliceFrom(source, prefixFor(sysDef.Prefixes, "snr")+sfx, idx); ok && j < len(row) {
+		if v, ok := toFloat(row[j]); ok {
+			ssi = ssiFromCN0(v)
+		}
+	}
+	return lli, ssi
+}
+
+// vsKeyFor returns the JSON VS array key for a display system, using the
+// active profile's data-system mapping (e.g. "C" -> "VSB" for BeiDou).
+func vsKeyFor(displaySys string) string {
+	sysDef, ok := activeProfile.Systems[displaySys]
 	if !ok {
-		return 0
+		return ""
 	}
-	slice, ok := asSliceAny(raw)
+	return fmt.Sprintf("VS%c", sysDef.DataSysRune(rune(displaySys[0])))
+}
+
+// epochSlice returns the per-epoch slice (e.g. a VS or measurement array)
+// for key at epoch position idx out of fieldValues, if present.
+func epochSlice(key string, idx int) ([]any, bool) {
+	return epochSliceFrom(fieldValues, key, idx)
+}
+
+// epochSliceFrom is epochSlice generalized over the field map to read
+// from, so writeBody's per-group scans (see scanFields) can reuse the
+// same lookup logic against a map other than the package-level
+// fieldValues.
+func epochSliceFrom(source map[string][]any, key string, idx int) ([]any, bool) {
+	vals, ok := source[key]
+	if !ok || idx < 0 || idx >= len(vals) {
+		return nil, false
+	}
+	return asSliceAny(vals[idx])
+}
+
+// Skip rows where all VS (G,E,B,Q,R) at index j are zero
+func getVSVal(idx int, key string, j int) float64 {
+	slice, ok := epochSlice(key, idx)
 	if !ok || j < 0 || j >= len(slice) {
 		return 0
 	}
@@ -493,44 +879,80 @@ func getVSVal(content map[string]any, key string, j int) float64 {
 	}
 	return 0
 }
-func isAllVSZero(content map[string]any, j int) bool {
-	for _, k := range []string{"VSG", "VSE", "VSQ", "VSR", "VSB"} {
-		if getVSVal(content, k, j) != 0 {
+func isAllVSZero(idx int, j int) bool {
+	for _, dispSys := range activeProfile.Order {
+		if getVSVal(idx, vsKeyFor(dispSys), j) != 0 {
 			return false
 		}
 	}
 	return true
 }
 
-func writeBody(w io.Writer) error {
-	// 1) Sort epoch keys
-	keys := make([]string, 0, len(epochs))
-	for ts := range epochs {
-		keys = append(keys, ts)
+// bandGroup is one (display system, band) pair writeBody's lazy path
+// reads in a single re-scan of sourcePath, e.g. {"G", "1", "G1"} for GPS
+// L1.
+type bandGroup struct {
+	dispSys string
+	sfx     string // data-system suffix, e.g. "G1", or "B2"/"Q1" for BeiDou/QZSS
+}
+
+// bandGroups returns every (system, band) combination the active profile
+// prints, in the same order writeBody's per-satellite loop visits them.
+func bandGroups() []bandGroup {
+	var groups []bandGroup
+	for _, dispSys := range activeProfile.Order {
+		sysDef := activeProfile.Systems[dispSys]
+		dataSys := sysDef.DataSysRune(rune(dispSys[0]))
+		for _, band := range sysDef.Bands {
+			groups = append(groups, bandGroup{dispSys: dispSys, sfx: fmt.Sprintf("%c%s", dataSys, band)})
+		}
 	}
-	sort.Strings(keys)
+	return groups
+}
 
-	// Constellation print order
-	sysOrder := []rune{'G', 'R', 'E', 'C', 'J'}
+// groupFieldKeys lists the JSON fields one bandGroup's scan needs: the
+// four observable kinds, plus the optional LLI/SSI flag arrays unless
+// --no-flags means bandFlagsFrom will never look at them.
+func groupFieldKeys(sysDef profile.SystemDef, sfx string) []string {
+	keys := make([]string, 0, len(obsKinds)+2)
+	for _, kind := range obsKinds {
+		keys = append(keys, prefixFor(sysDef.Prefixes, kind)+sfx)
+	}
+	if noFlags {
+		return keys
+	}
+	return append(keys, lliPrefix+sfx, ssiPrefix+sfx)
+}
 
-	bw, _ := w.(*bufio.Writer)
+// epochPrintPlan is one epoch's worth of the satellite-selection decision
+// writeBody makes before it ever looks at a single observable value: which
+// VS-array indexes survive uniqPRNIndexes + isAllVSZero, per system. It's
+// computed once, from the eagerly-decoded VS arrays alone, and shared by
+// every bandGroup's pass and the final merge so that selection logic
+// lives in exactly one place and every group agrees on it.
+type epochPrintPlan struct {
+	idx          int
+	ts           string
+	prns         map[string][]int // dispSys -> full per-epoch PRN slice
+	kept         map[string][]int // dispSys -> VS-array indexes to print, in print order
+	totalPrinted int
+}
 
-	for _, ts := range keys {
-		content := epochs[ts]
+// buildPrintPlan walks epochOrder once and reproduces the PRN-selection
+// steps writeBody used to do inline, keyed only off the VS arrays (always
+// eager, see eagerFieldKeys) so it needs none of the large per-band
+// fields a bandGroup scan fetches later.
+func buildPrintPlan() []epochPrintPlan {
+	sysOrder := activeProfile.Order
+	plan := make([]epochPrintPlan, len(epochOrder))
 
-		// 2) Build PRN slices per system from the VS arrays (do NOT sort)
-		sysPRNs := map[rune][]int{}
+	for pi, idx := range epochOrder {
+		sysPRNs := map[string][]int{}
 		for _, dispSys := range sysOrder {
-			vsKey := vsKeyFor(dispSys) // e.g. "VSG", "VSR", "VSE", "VSB", "VSQ"
-			vsVal, ok := content[vsKey]
+			vsSlice, ok := epochSlice(vsKeyFor(dispSys), idx)
 			if !ok {
 				continue
 			}
-			vsSlice, ok := asSliceAny(vsVal)
-			if !ok {
-				continue
-			}
-
 			prns := make([]int, len(vsSlice))
 			for j, v := range vsSlice {
 				if prn, ok := toInt(v); ok {
@@ -540,74 +962,136 @@ func writeBody(w io.Writer) error {
 			sysPRNs[dispSys] = prns
 		}
 
-		// 3) Build the index lists to print (unique PRNs and not all-VS-zero)
-		sysIdxToPrint := map[rune][]int{}
+		kept := map[string][]int{}
 		totalPrinted := 0
 		for _, dispSys := range sysOrder {
 			prns := sysPRNs[dispSys]
 			if len(prns) == 0 {
 				continue
 			}
-
-			// unique PRNs -> get the indexes we will keep
-			uniqIdx := uniqPRNIndexes(prns)
-
-			// apply your “skip rows with all VS=0” rule per kept index
-			kept := make([]int, 0, len(uniqIdx))
-			for _, j := range uniqIdx {
-				if prns[j] <= 0 {
+			k := make([]int, 0, len(prns))
+			for _, j := range uniqPRNIndexes(prns) {
+				if prns[j] <= 0 || isAllVSZero(idx, j) {
 					continue
 				}
-				if isAllVSZero(content, j) {
+				k = append(k, j)
+			}
+			kept[dispSys] = k
+			totalPrinted += len(k)
+		}
+
+		plan[pi] = epochPrintPlan{idx: idx, ts: recordTimes[idx], prns: sysPRNs, kept: kept, totalPrinted: totalPrinted}
+	}
+	return plan
+}
+
+// writeGroupPass scans sourcePath for one bandGroup's fields (at most a
+// handful of arrays, not the whole file) and, for every epoch/satellite
+// plan.kept selects, writes one formatted C/L/D/S-plus-flags chunk per
+// line to a fresh temp file. The chunks are written in the exact order
+// the final merge pass will read them back in, so no epoch/satellite
+// bookkeeping needs to be repeated or stored.
+func writeGroupPass(plan []epochPrintPlan, g bandGroup) (tmpPath string, err error) {
+	sysDef := activeProfile.Systems[g.dispSys]
+
+	want := make(map[string]bool)
+	for _, key := range groupFieldKeys(sysDef, g.sfx) {
+		want[key] = true
+	}
+	fields, err := scanFields(sourcePath, want)
+	if err != nil {
+		return "", fmt.Errorf("scan band %s in %s: %w", g.sfx, sourcePath, err)
+	}
+
+	tmp, err := os.CreateTemp("", "rinex-band-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+	defer func() {
+		// A failure partway through writing this group's temp file means
+		// it never makes it into writeBody's tmpPaths map, so its normal
+		// cleanup defer won't see it; remove it here instead so a failed
+		// run doesn't leak scratch files under os.TempDir().
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	bw := bufio.NewWriter(tmp)
+
+	for _, ep := range plan {
+		for _, j := range ep.kept[g.dispSys] {
+			lli, ssi := bandFlagsFrom(fields, ep.idx, j, g.sfx, sysDef)
+
+			var b strings.Builder
+			for _, kind := range obsKinds {
+				row, ok := epochSliceFrom(fields, prefixFor(sysDef.Prefixes, kind)+g.sfx, ep.idx)
+				if !ok || j >= len(row) {
+					b.WriteString(fmtObs(nil, flagAbsent, flagAbsent, precFor(kind)))
 					continue
 				}
-				kept = append(kept, j)
+				b.WriteString(fmtObs(row[j], lli, ssi, precFor(kind)))
+			}
+			if _, err := fmt.Fprintln(bw, b.String()); err != nil {
+				return "", err
 			}
+		}
+	}
 
-			sysIdxToPrint[dispSys] = kept
-			totalPrinted += len(kept)
+	if err := bw.Flush(); err != nil {
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// mergeGroupPasses replays plan once more, reading each system's band
+// chunks back from its group's temp file (opened once, read
+// sequentially — writeGroupPass wrote them in this same epoch/satellite
+// order) to assemble and emit the final fixed-width line, so at no point
+// does the merge hold more than one line per open temp file in memory.
+func mergeGroupPasses(w io.Writer, plan []epochPrintPlan, groups []bandGroup, tmpPaths map[bandGroup]string) error {
+	readers := make(map[bandGroup]*bufio.Scanner, len(groups))
+	for _, g := range groups {
+		f, err := os.Open(tmpPaths[g])
+		if err != nil {
+			return err
 		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64*1024), 1<<20)
+		readers[g] = sc
+	}
+
+	groupsBySys := make(map[string][]bandGroup, len(activeProfile.Order))
+	for _, g := range groups {
+		groupsBySys[g.dispSys] = append(groupsBySys[g.dispSys], g)
+	}
 
-		// 4) Epoch line
-		epochLine := fmt.Sprintf("%s %d", formatObsEpoch(ts), totalPrinted)
+	bw, _ := w.(*bufio.Writer)
+
+	for _, ep := range plan {
+		epochLine := fmt.Sprintf("%s %d", formatObsEpoch(ep.ts), ep.totalPrinted)
 		if _, err := fmt.Fprintln(w, epochLine); err != nil {
 			return err
 		}
 
-		// 5) Emit rows in G,R,E,C,J order, using the kept indexes (alignment preserved)
-		for _, dispSys := range sysOrder {
-			prns := sysPRNs[dispSys]
-			idxs := sysIdxToPrint[dispSys]
+		for _, dispSys := range activeProfile.Order {
+			idxs := ep.kept[dispSys]
 			if len(idxs) == 0 {
 				continue
 			}
-
-			dataSys := displayToDataSys[dispSys] // C->B, J->Q mapping for suffixes
-			bands := bandsFor(dispSys)           // e.g. G: ["1","2"], E: ["1","7"], C: ["2","7"] ...
+			prns := ep.prns[dispSys]
 
 			for _, j := range idxs {
-				prn := prns[j]
 				var b strings.Builder
-				b.WriteString(satID(dispSys, prn)) // display letter
-				// print CLDS per band
-				for _, band := range bands {
-					sfx := fmt.Sprintf("%c%s", dataSys, band) // data suffix (B or Q if C/J)
-					for _, pref := range measPrefixes {       // "prMes_","cpMes_","doMes_","cn0_"
-						key := pref + sfx
-						val, has := content[key]
-						if !has {
-							b.WriteString(fmtObs(nil, precFor(pref)))
-							continue
-						}
-						row, ok := asSliceAny(val)
-						if !ok || j >= len(row) {
-							b.WriteString(fmtObs(nil, precFor(pref)))
-							continue
-						}
-						b.WriteString(fmtObs(row[j], precFor(pref)))
+				b.WriteString(satID(rune(dispSys[0]), prns[j]))
+				for _, g := range groupsBySys[dispSys] {
+					sc := readers[g]
+					if !sc.Scan() {
+						return fmt.Errorf("band %s temp data ran out before plan was exhausted", g.sfx)
 					}
+					b.WriteString(sc.Text())
 				}
-
 				if _, err := fmt.Fprintln(w, b.String()); err != nil {
 					return err
 				}
@@ -621,25 +1105,401 @@ func writeBody(w io.Writer) error {
 	return nil
 }
 
+// writeBody prints the plain (non-compact) RINEX 3 observation body.
+// Rather than hold every field's whole-file array in memory at once (as
+// createEpochs does for writeCompactBody), it processes one (system,
+// band) group at a time: buildPrintPlan decides, from the small eager VS
+// arrays alone, which satellites each epoch keeps; writeGroupPass then
+// re-reads sourcePath once per group to fetch just that group's handful
+// of per-band fields, writing each kept satellite's formatted chunk to a
+// temp file before discarding the group's decoded data; mergeGroupPasses
+// replays the plan a final time, pulling one line at a time from each
+// group's temp file to assemble and emit the real output. Peak memory is
+// therefore the print plan plus one group's data at a time, not the
+// whole file — at the cost of one extra sequential pass over the source
+// file per (system, band) group.
+func writeBody(w io.Writer) error {
+	plan := buildPrintPlan()
+	groups := bandGroups()
+
+	tmpPaths := make(map[bandGroup]string, len(groups))
+	defer func() {
+		for _, p := range tmpPaths {
+			os.Remove(p)
+		}
+	}()
+
+	for _, g := range groups {
+		tmpPath, err := writeGroupPass(plan, g)
+		if err != nil {
+			return err
+		}
+		tmpPaths[g] = tmpPath
+	}
+
+	return mergeGroupPasses(w, plan, groups, tmpPaths)
+}
+
+// writeCompactBody walks the epochs in the same order and with the same
+// PRN-selection rules as writeBody, but feeds each satellite's
+// observations into a compact.Writer instead of formatting fixed-width
+// text, producing a Hatanaka-style compact RINEX (.crx) body.
+func writeCompactBody(cw *compact.Writer) error {
+	sysOrder := activeProfile.Order
+
+	for _, idx := range epochOrder {
+		ts := recordTimes[idx]
+		epochTime, err := parseEpoch(ts)
+		if err != nil {
+			return fmt.Errorf("parse epoch %q: %w", ts, err)
+		}
+
+		sysPRNs := map[string][]int{}
+		for _, dispSys := range sysOrder {
+			vsSlice, ok := epochSlice(vsKeyFor(dispSys), idx)
+			if !ok {
+				continue
+			}
+			prns := make([]int, len(vsSlice))
+			for j, v := range vsSlice {
+				if prn, ok := toInt(v); ok {
+					prns[j] = prn
+				}
+			}
+			sysPRNs[dispSys] = prns
+		}
+
+		var sats []compact.SatObs
+		for _, dispSys := range sysOrder {
+			prns := sysPRNs[dispSys]
+			if len(prns) == 0 {
+				continue
+			}
+			sysDef := activeProfile.Systems[dispSys]
+			dataSys := sysDef.DataSysRune(rune(dispSys[0]))
+
+			for _, j := range uniqPRNIndexes(prns) {
+				prn := prns[j]
+				if prn <= 0 || isAllVSZero(idx, j) {
+					continue
+				}
+
+				obs := make([]compact.Obs, 0, len(sysDef.Bands)*len(obsKinds))
+				for _, band := range sysDef.Bands {
+					sfx := fmt.Sprintf("%c%s", dataSys, band)
+					lli, ssi := bandFlags(idx, j, sfx, sysDef)
+					for _, kind := range obsKinds {
+						row, ok := epochSlice(prefixFor(sysDef.Prefixes, kind)+sfx, idx)
+						val := math.NaN()
+						if ok && j < len(row) {
+							if f, ok := toFloat(row[j]); ok {
+								val = f
+							}
+						}
+						obs = append(obs, compact.Obs{Value: val, LLI: lli, SSI: ssi})
+					}
+				}
+				sats = append(sats, compact.SatObs{ID: satID(rune(dispSys[0]), prn), Obs: obs})
+			}
+		}
+
+		if err := cw.WriteEpoch(epochTime.Unix(), sats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- RINEX NAV (broadcast ephemeris) support ---
+
+// hasEphemeris reports whether the decoded JSON carries the eph_sys/
+// eph_prn arrays a NAV file is built from.
+func hasEphemeris() bool {
+	_, hasSys := fieldValues["eph_sys"]
+	_, hasPRN := fieldValues["eph_prn"]
+	return hasSys && hasPRN
+}
+
+// ephFloat returns eph_<field>[i] as a float64, or 0 if the field or
+// index is absent.
+func ephFloat(field string, i int) float64 {
+	vals, ok := fieldValues["eph_"+field]
+	if !ok || i < 0 || i >= len(vals) {
+		return 0
+	}
+	f, _ := toFloat(vals[i])
+	return f
+}
+
+// ephInt returns eph_<field>[i] as an int, or 0 if the field or index is
+// absent.
+func ephInt(field string, i int) int {
+	vals, ok := fieldValues["eph_"+field]
+	if !ok || i < 0 || i >= len(vals) {
+		return 0
+	}
+	v, _ := toInt(vals[i])
+	return v
+}
+
+// ephTime parses eph_toc[i] the same way recordTime entries are parsed.
+func ephTime(i int) (time.Time, error) {
+	vals, ok := fieldValues["eph_toc"]
+	if !ok || i < 0 || i >= len(vals) {
+		return time.Time{}, fmt.Errorf("eph_toc[%d] missing", i)
+	}
+	s, _ := vals[i].(string)
+	return parseEpoch(s)
+}
+
+// buildKeplerianRecord reads broadcast record i into a GPS/Galileo/
+// BeiDou/QZSS Keplerian set.
+func buildKeplerianRecord(sys rune, i int) (nav.KeplerianRecord, error) {
+	prn := ephInt("prn", i)
+	toc, err := ephTime(i)
+	if err != nil {
+		return nav.KeplerianRecord{}, err
+	}
+	return nav.KeplerianRecord{
+		Sys: sys, PRN: prn, Toc: toc,
+		ClockBias: ephFloat("af0", i), ClockDrift: ephFloat("af1", i), ClockDriftRate: ephFloat("af2", i),
+
+		IODE: ephFloat("iode", i), Crs: ephFloat("crs", i), DeltaN: ephFloat("deltaN", i), M0: ephFloat("m0", i),
+		Cuc: ephFloat("cuc", i), Ecc: ephFloat("e", i), Cus: ephFloat("cus", i), SqrtA: ephFloat("sqrtA", i),
+		Toe: ephFloat("toe", i), Cic: ephFloat("cic", i), Omega0: ephFloat("omega0", i), Cis: ephFloat("cis", i),
+		I0: ephFloat("i0", i), Crc: ephFloat("crc", i), Omega: ephFloat("omega", i), OmegaDot: ephFloat("omegaDot", i),
+		IDot: ephFloat("idot", i), CodesL2: ephFloat("codesL2", i), WeekNum: ephFloat("weekNum", i), L2PFlag: ephFloat("l2pFlag", i),
+		SVAccuracy: ephFloat("svAccuracy", i), SVHealth: ephFloat("svHealth", i), TGD: ephFloat("tgd", i), IODC: ephFloat("iodc", i),
+		TransmissionTime: ephFloat("transmissionTime", i), FitInterval: ephFloat("fitInterval", i),
+	}, nil
+}
+
+// buildGlonassRecord reads broadcast record i into a GLONASS state-vector
+// set.
+func buildGlonassRecord(i int) (nav.GlonassRecord, error) {
+	prn := ephInt("prn", i)
+	toc, err := ephTime(i)
+	if err != nil {
+		return nav.GlonassRecord{}, err
+	}
+	return nav.GlonassRecord{
+		PRN: prn, Toc: toc,
+		ClockBias: ephFloat("af0", i), RelFreqBias: ephFloat("af1", i), MsgFrameTime: ephFloat("msgFrameTime", i),
+
+		X: ephFloat("x", i), VelX: ephFloat("velX", i), AccelX: ephFloat("accelX", i), Health: ephFloat("health", i),
+		Y: ephFloat("y", i), VelY: ephFloat("velY", i), AccelY: ephFloat("accelY", i), FreqNum: ephFloat("freqNum", i),
+		Z: ephFloat("z", i), VelZ: ephFloat("velZ", i), AccelZ: ephFloat("accelZ", i), AgeOp: ephFloat("ageOp", i),
+	}, nil
+}
+
+// ionoCorrections reads the optional iono_corr array (a list of
+// {"type", "coeffs"} objects) into nav.IonoCorr values.
+func ionoCorrections() []nav.IonoCorr {
+	raw, ok := fieldValues["iono_corr"]
+	if !ok {
+		return nil
+	}
+	var out []nav.IonoCorr
+	for _, v := range raw {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		typ, _ := obj["type"].(string)
+		coeffsAny, _ := obj["coeffs"].([]any)
+		var coeffs [4]float64
+		for i := 0; i < len(coeffsAny) && i < 4; i++ {
+			coeffs[i], _ = toFloat(coeffsAny[i])
+		}
+		out = append(out, nav.IonoCorr{Type: typ, Coeffs: coeffs})
+	}
+	return out
+}
+
+// timeSystemCorrections reads the optional clk_corr array (a list of
+// {"type", "a0", "a1", "refTime", "refWeek"} objects) into
+// nav.TimeSystemCorr values.
+func timeSystemCorrections() []nav.TimeSystemCorr {
+	raw, ok := fieldValues["clk_corr"]
+	if !ok {
+		return nil
+	}
+	var out []nav.TimeSystemCorr
+	for _, v := range raw {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		typ, _ := obj["type"].(string)
+		a0, _ := toFloat(obj["a0"])
+		a1, _ := toFloat(obj["a1"])
+		refTime, _ := toInt(obj["refTime"])
+		refWeek, _ := toInt(obj["refWeek"])
+		out = append(out, nav.TimeSystemCorr{Type: typ, A0: a0, A1: a1, RefTime: refTime, RefWeek: refWeek})
+	}
+	return out
+}
+
+// writeNavFile builds and writes a RINEX 3.04 NAV file from the decoded
+// eph_*/iono_*/clk_* fields: one Keplerian or GLONASS record block per
+// entry in eph_sys/eph_prn, in that array's order.
+func writeNavFile(w io.Writer) error {
+	nw := nav.NewWriter(w)
+	if err := nw.WriteHeader(ionoCorrections(), timeSystemCorrections(), time.Now().UTC()); err != nil {
+		return err
+	}
+
+	for i, v := range fieldValues["eph_sys"] {
+		sysStr, _ := v.(string)
+		if sysStr == "" {
+			continue
+		}
+		sys := rune(sysStr[0])
+
+		if sys == 'R' {
+			rec, err := buildGlonassRecord(i)
+			if err != nil {
+				return err
+			}
+			if err := nw.WriteGlonass(rec); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rec, err := buildKeplerianRecord(sys, i)
+		if err != nil {
+			return err
+		}
+		if err := nw.WriteKeplerian(rec); err != nil {
+			return err
+		}
+	}
+
+	return nw.Flush()
+}
+
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Please specify an observation file:")
-		fmt.Printf("Example: %s %s\n", filepath.Base(os.Args[0]), "observation12.json")
+	var compactOut bool
+	var gzipOut bool
+	var profilePath string
+	var glonassSlotsFlag string
+	var navOnly, noNav bool
+	flag.BoolVar(&compactOut, "compact", false, "write a Hatanaka-compact RINEX (.crx) file instead of plain .obs")
+	flag.BoolVar(&compactOut, "c", false, "shorthand for --compact")
+	flag.BoolVar(&gzipOut, "gzip", false, "gzip the compact RINEX output as .crx.gz (implies --compact)")
+	flag.BoolVar(&gzipOut, "z", false, "shorthand for --gzip")
+	flag.StringVar(&profilePath, "profile", "", "path to a YAML/JSON signal-plan profile (default: built-in ublox-basic)")
+	flag.BoolVar(&noFlags, "no-flags", false, "omit LLI/SSI flag columns, matching pre-flags output exactly")
+	flag.StringVar(&glonassSlotsFlag, "glonass-slots", "", "override GLONASS PRN->channel map, e.g. R01=1,R02=-4")
+	flag.BoolVar(&navOnly, "nav-only", false, "write only the RINEX NAV (.nav) file, skipping OBS/compact output")
+	flag.BoolVar(&noNav, "no-nav", false, "skip RINEX NAV output even when ephemeris fields are present")
+	flag.Usage = func() {
+		fmt.Printf("Usage: %s [-c|--compact] [-z|--gzip] [--profile path.yaml] [--no-flags] [--glonass-slots R01=1,...] [--nav-only|--no-nav] <observation.json>\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if gzipOut {
+		compactOut = true
+	}
+
+	glonassSlotOverrides, err := parseGlonassSlots(glonassSlotsFlag)
+	epanic(err)
+
+	if flag.NArg() != 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
+	if navOnly && noNav {
+		epanic(fmt.Errorf("--nav-only and --no-nav are mutually exclusive"))
+	}
+
+	if profilePath == "" {
+		activeProfile = profile.Default()
+	} else {
+		p, err := profile.Load(profilePath)
+		epanic(err)
+		activeProfile = p
+	}
+
 	// Create ./rinex/ dir if not present
 	ensureRinexDir()
 
-	file := os.Args[1]
-	createEpochs(file)
+	file := flag.Arg(0)
+	createEpochs(file, !compactOut)
 
 	_, relativeFile := filepath.Split(file)
 	fileName := strings.Split(relativeFile, ".")[0]
 
-	header, err := getHeaderFixed()
+	if !noNav && (navOnly || hasEphemeris()) {
+		navFileString := fmt.Sprintf("./rinex/%v.nav", fileName)
+		navF, err := os.Create(navFileString)
+		if err != nil {
+			panic(err)
+		}
+		defer navF.Close()
+
+		if err := writeNavFile(navF); err != nil {
+			panic(err)
+		}
+	}
+
+	if navOnly {
+		return
+	}
+
+	first := recordTimes[epochOrder[0]]
+	last := recordTimes[epochOrder[len(epochOrder)-1]]
+	sortedTimes := make([]string, len(epochOrder))
+	for i, idx := range epochOrder {
+		sortedTimes[i] = recordTimes[idx]
+	}
+	intervalSec := estimateInterval(sortedTimes)
+
+	glonassSlots := glonassChannels()
+	for prn, ch := range glonassSlotOverrides {
+		glonassSlots[prn] = ch
+	}
+
+	header, err := getHeaderFixed(first, last, intervalSec, glonassSlots)
 	epanic(err)
 
+	if compactOut {
+		ext := ".crx"
+		if gzipOut {
+			ext = ".crx.gz"
+		}
+		fileString := fmt.Sprintf("./rinex/%v%s", fileName, ext)
+		f, err := os.Create(fileString)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+
+		var out io.Writer = f
+		var gz *gzip.Writer
+		if gzipOut {
+			gz = gzip.NewWriter(f)
+			out = gz
+		}
+
+		if _, err := fmt.Fprint(out, header); err != nil {
+			epanic(err)
+		}
+
+		cw := compact.NewWriter(out, compact.DefaultOrder)
+		if err := writeCompactBody(cw); err != nil {
+			panic(err)
+		}
+		epanic(cw.Flush())
+		if gz != nil {
+			epanic(gz.Close())
+		}
+		return
+	}
+
 	//  write to a file
 	fileString := fmt.Sprintf("./rinex/%v.obs", fileName)
 	f, err := os.Create(fileString)
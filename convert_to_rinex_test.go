@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tsmith-vs/gnss-json-to-rinex3/profile"
+)
+
+// testProfile is a minimal two-system, one-band profile (unlike
+// profile.Default()'s two bands per system) so the expected body below
+// stays small enough to write out by hand.
+func testProfile() profile.Profile {
+	prefixes := profile.ObsPrefixes{Code: "prMes_", Phase: "cpMes_", Doppler: "doMes_", SNR: "cn0_"}
+	return profile.Profile{
+		Name:  "test-minimal",
+		Order: []string{"G", "R"},
+		Systems: map[string]profile.SystemDef{
+			"G": {Bands: []string{"1"}, ObsCodes: map[string][]string{"1": {"C1C", "L1C", "D1C", "S1C"}}, Prefixes: prefixes},
+			"R": {Bands: []string{"1"}, ObsCodes: map[string][]string{"1": {"C1C", "L1C", "D1C", "S1C"}}, Prefixes: prefixes},
+		},
+	}
+}
+
+// fixtureJSON is a small, column-oriented observation dump: two epochs,
+// one GPS satellite (with LLI/SSI flags) and one GLONASS satellite
+// (without, so its SSI is derived from cn0_ via ssiFromCN0), plus enough
+// eph_* fields to produce one Keplerian and one GLONASS NAV record.
+const fixtureJSON = `{
+	"recordTime": ["2025-01-01 00:00:00", "2025-01-01 00:00:01"],
+	"VSG": [[1], [1]],
+	"VSR": [[2], [2]],
+	"gloFrq": [[-3], [-3]],
+	"prMes_G1": [[20000000.123], [20000001.456]],
+	"cpMes_G1": [[105000000.12345], [105000001.6789]],
+	"doMes_G1": [[1234.5], [1234.6]],
+	"cn0_G1": [[45.0], [44.0]],
+	"lli_G1": [[0], [1]],
+	"ssi_G1": [[7], [6]],
+	"prMes_R1": [[19000000.1], [19000001.2]],
+	"cpMes_R1": [[100000000.1], [100000001.2]],
+	"doMes_R1": [[555.5], [555.6]],
+	"cn0_R1": [[33.0], [32.0]],
+	"eph_sys": ["G", "R"],
+	"eph_prn": [1, 2],
+	"eph_toc": ["2025-01-01 00:00:00", "2025-01-01 00:00:00"],
+	"eph_af0": [0.0001, 0.0],
+	"eph_x": [0, 1000.0],
+	"eph_freqNum": [0, -3]
+}`
+
+// writeFixture writes fixtureJSON to a temp file and resets the package
+// globals createEpochs/writeBody/writeNavFile depend on, the same way
+// main() would before a run.
+func writeFixture(t *testing.T) string {
+	t.Helper()
+	activeProfile = testProfile()
+	noFlags = false
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "obs.json")
+	if err := os.WriteFile(path, []byte(fixtureJSON), 0o644); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	return path
+}
+
+// TestCreateEpochsAndWriteBodyProducesExpectedRows runs the lazy,
+// group-scanned .obs path (createEpochs with lazyBody=true, then
+// writeBody) end to end against a known fixture and checks the produced
+// body matches byte-for-byte, the same way compact_test.go's round-trip
+// test validates that package. createEpochs/writeBody is the riskiest
+// code in the converter (hand-rolled token walking, plus writeBody's
+// per-(system,band) re-scan and temp-file merge), so this is the test
+// that would catch a broken group/merge alignment.
+func TestCreateEpochsAndWriteBodyProducesExpectedRows(t *testing.T) {
+	path := writeFixture(t)
+	createEpochs(path, true)
+
+	var buf bytes.Buffer
+	if err := writeBody(&buf); err != nil {
+		t.Fatalf("writeBody: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"> 2025 01 01 00 00 00.0000000  0 2",
+		"G01  20000000.12307105000000.1234507      1234.50007        45.00007",
+		"R02  19000000.100 5100000000.10000 5       555.500 5        33.000 5",
+		"> 2025 01 01 00 00 01.0000000  0 2",
+		"G01  20000001.45616105000001.6789016      1234.60016        44.00016",
+		"R02  19000001.200 5100000001.20000 5       555.600 5        32.000 5",
+		"",
+	}, "\n")
+
+	if got := buf.String(); got != want {
+		t.Fatalf("writeBody output mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestCreateEpochsLazyModeMatchesEagerMode checks that skipping the
+// per-band fields in createEpochs (lazyBody=true, the plain-.obs path)
+// and re-fetching them per group in writeBody produces the exact same
+// body as decoding everything eagerly up front (lazyBody=false, the path
+// --compact still relies on) — i.e. that the group/temp-file rework is
+// purely a memory optimization, not a behavior change.
+func TestCreateEpochsLazyModeMatchesEagerMode(t *testing.T) {
+	path := writeFixture(t)
+
+	createEpochs(path, true)
+	var lazyBuf bytes.Buffer
+	if err := writeBody(&lazyBuf); err != nil {
+		t.Fatalf("writeBody (lazy): %v", err)
+	}
+
+	createEpochs(path, false)
+	var eagerBuf bytes.Buffer
+	if err := writeBody(&eagerBuf); err != nil {
+		t.Fatalf("writeBody (eager): %v", err)
+	}
+
+	if lazyBuf.String() != eagerBuf.String() {
+		t.Fatalf("lazy and eager createEpochs produced different bodies:\nlazy:\n%s\neager:\n%s", lazyBuf.String(), eagerBuf.String())
+	}
+}
+
+// TestWriteNavFileProducesKeplerianAndGlonassBlocks runs writeNavFile
+// against the fixture's eph_* fields and checks it emits one 8-line
+// Keplerian block for the GPS record and one 4-line GLONASS block for the
+// GLONASS record, in eph_sys/eph_prn order — the same structural style
+// nav_test.go uses for the nav package's own writer.
+func TestWriteNavFileProducesKeplerianAndGlonassBlocks(t *testing.T) {
+	path := writeFixture(t)
+	createEpochs(path, true)
+
+	var buf bytes.Buffer
+	if err := writeNavFile(&buf); err != nil {
+		t.Fatalf("writeNavFile: %v", err)
+	}
+
+	out := buf.String()
+	headerEnd := strings.Index(out, "END OF HEADER")
+	if headerEnd == -1 {
+		t.Fatalf("expected an END OF HEADER line, got:\n%s", out)
+	}
+	bodyStart := strings.Index(out[headerEnd:], "\n") + headerEnd + 1
+	lines := strings.Split(strings.TrimRight(out[bodyStart:], "\n"), "\n")
+
+	if len(lines) != 12 { // 8 for the GPS Keplerian record + 4 for the GLONASS record
+		t.Fatalf("expected 12 body lines (8 Keplerian + 4 GLONASS), got %d:\n%s", len(lines), out)
+	}
+	if !strings.HasPrefix(lines[0], "G01 ") {
+		t.Fatalf("expected the first record to start with G01's epoch line, got %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[8], "R02 ") {
+		t.Fatalf("expected the second record to start with R02's epoch line, got %q", lines[8])
+	}
+}
+
+// TestScanFieldsDecodesOnlyWantedKeysAndSkipsRest exercises scanFields
+// (and, through it, decodeValue and skipValue) directly: given a "want"
+// set covering only some of a document's top-level fields, it should
+// return decoded arrays for exactly those fields and silently discard
+// every other field's tokens, however they're shaped (a value the plain
+// decode/skip recursion has to walk correctly, not just a flat array).
+func TestScanFieldsDecodesOnlyWantedKeysAndSkipsRest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scan.json")
+	doc := `{
+		"wanted": [1, 2, 3],
+		"skippedArray": [[1, 2], [3, 4], "x"],
+		"skippedObject": {"a": {"b": [1, 2, {"c": 3}]}},
+		"skippedScalar": "hello",
+		"alsoWanted": [[10], [20]]
+	}`
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	got, err := scanFields(path, map[string]bool{"wanted": true, "alsoWanted": true})
+	if err != nil {
+		t.Fatalf("scanFields: %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected exactly 2 decoded keys, got %d: %v", len(got), got)
+	}
+	wantedVals, ok := got["wanted"]
+	if !ok {
+		t.Fatalf("expected %q in scanFields result, got %v", "wanted", got)
+	}
+	var wantedJSON []byte
+	wantedJSON, err = json.Marshal(wantedVals)
+	if err != nil {
+		t.Fatalf("marshal wanted: %v", err)
+	}
+	if string(wantedJSON) != "[1,2,3]" {
+		t.Fatalf("wanted decoded as %s, want [1,2,3]", wantedJSON)
+	}
+	if _, ok := got["skippedArray"]; ok {
+		t.Fatalf("expected skippedArray to be skipped, not decoded")
+	}
+	if _, ok := got["skippedObject"]; ok {
+		t.Fatalf("expected skippedObject to be skipped, not decoded")
+	}
+}
@@ -0,0 +1,174 @@
+// Package nav writes RINEX 3.04 GNSS navigation (broadcast ephemeris)
+// files: one "N: GNSS NAV DATA" header, optionally carrying IONOSPHERIC
+// CORR and TIME SYSTEM CORR lines, followed by one record block per
+// broadcast ephemeris — 8 lines (1 epoch + 7 data) for the GPS/Galileo/
+// BeiDou/QZSS Keplerian orbit model, 4 lines (1 epoch + 3 data) for the
+// GLONASS state-vector model.
+package nav
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// IonoCorr is one IONOSPHERIC CORR header line, e.g. type "GPSA" with its
+// four alpha (or beta) coefficients.
+type IonoCorr struct {
+	Type   string // "GPSA", "GPSB", "GAL", "BDSA", "BDSB"
+	Coeffs [4]float64
+}
+
+// TimeSystemCorr is one TIME SYSTEM CORR header line, e.g. "GPUT" for the
+// GPS-to-UTC correction.
+type TimeSystemCorr struct {
+	Type    string // "GPUT", "GLUT", "GAUT", "BDUT", ...
+	A0, A1  float64
+	RefTime int
+	RefWeek int
+}
+
+// KeplerianRecord is one GPS/Galileo/BeiDou/QZSS broadcast ephemeris set,
+// in RINEX 3's standard broadcast-orbit field order.
+type KeplerianRecord struct {
+	Sys rune // 'G', 'E', 'C', or 'J'
+	PRN int
+	Toc time.Time
+
+	ClockBias, ClockDrift, ClockDriftRate float64
+
+	IODE, Crs, DeltaN, M0           float64
+	Cuc, Ecc, Cus, SqrtA            float64
+	Toe, Cic, Omega0, Cis           float64
+	I0, Crc, Omega, OmegaDot        float64
+	IDot, CodesL2, WeekNum, L2PFlag float64
+	SVAccuracy, SVHealth, TGD, IODC float64
+	TransmissionTime, FitInterval   float64
+}
+
+// GlonassRecord is one GLONASS broadcast state-vector set.
+type GlonassRecord struct {
+	PRN int
+	Toc time.Time
+
+	ClockBias, RelFreqBias, MsgFrameTime float64
+
+	X, VelX, AccelX, Health  float64
+	Y, VelY, AccelY, FreqNum float64
+	Z, VelZ, AccelZ, AgeOp   float64
+}
+
+// Writer emits a RINEX 3.04 NAV file: a header followed by any number of
+// Keplerian and/or GLONASS record blocks.
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter returns a Writer wrapping w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func headerLine(body, label string) string {
+	if len(body) > 60 {
+		body = body[:60]
+	}
+	return fmt.Sprintf("%-60s%-20s\n", body, label)
+}
+
+// exp19 formats v as RINEX 3's right-justified %19.12E broadcast-orbit
+// field.
+func exp19(v float64) string {
+	return fmt.Sprintf("%19.12E", v)
+}
+
+// WriteHeader writes the NAV file header: RINEX VERSION / TYPE and PGM /
+// RUN BY / DATE, then one IONOSPHERIC CORR line per entry in iono and one
+// TIME SYSTEM CORR line per entry in timeSys, then END OF HEADER. genTime
+// is used for PGM / RUN BY / DATE.
+func (nw *Writer) WriteHeader(iono []IonoCorr, timeSys []TimeSystemCorr, genTime time.Time) error {
+	var hdr strings.Builder
+	hdr.WriteString(headerLine("     3.04           N: GNSS NAV DATA", "RINEX VERSION / TYPE"))
+	hdr.WriteString(headerLine(
+		fmt.Sprintf("%-20s%-20s%-20s", "gnss-json-to-rinex3", "User", genTime.Format("20060102 150405 UTC")),
+		"PGM / RUN BY / DATE",
+	))
+
+	for _, c := range iono {
+		body := fmt.Sprintf("%-4s%12.4E%12.4E%12.4E%12.4E", c.Type, c.Coeffs[0], c.Coeffs[1], c.Coeffs[2], c.Coeffs[3])
+		hdr.WriteString(headerLine(body, "IONOSPHERIC CORR"))
+	}
+	for _, c := range timeSys {
+		body := fmt.Sprintf("%-4s%19.12E%19.12E%7d%5d", c.Type, c.A0, c.A1, c.RefTime, c.RefWeek)
+		hdr.WriteString(headerLine(body, "TIME SYSTEM CORR"))
+	}
+
+	hdr.WriteString(headerLine("", "END OF HEADER"))
+	_, err := nw.w.WriteString(hdr.String())
+	return err
+}
+
+func (nw *Writer) writeEpochLine(satID string, toc time.Time, f0, f1, f2 float64) error {
+	_, err := fmt.Fprintf(nw.w, "%-3s %04d %02d %02d %02d %02d %02d%s%s%s\n",
+		satID, toc.Year(), int(toc.Month()), toc.Day(), toc.Hour(), toc.Minute(), toc.Second(),
+		exp19(f0), exp19(f1), exp19(f2))
+	return err
+}
+
+func (nw *Writer) writeDataLine(f0, f1, f2, f3 float64) error {
+	_, err := fmt.Fprintf(nw.w, "    %s%s%s%s\n", exp19(f0), exp19(f1), exp19(f2), exp19(f3))
+	return err
+}
+
+// WriteKeplerian writes one GPS/Galileo/BeiDou/QZSS record as an 8-line
+// block: the epoch/clock line followed by 7 lines of 4 broadcast-orbit
+// fields each.
+func (nw *Writer) WriteKeplerian(r KeplerianRecord) error {
+	satID := fmt.Sprintf("%c%02d", r.Sys, r.PRN)
+	if err := nw.writeEpochLine(satID, r.Toc, r.ClockBias, r.ClockDrift, r.ClockDriftRate); err != nil {
+		return err
+	}
+
+	lines := [7][4]float64{
+		{r.IODE, r.Crs, r.DeltaN, r.M0},
+		{r.Cuc, r.Ecc, r.Cus, r.SqrtA},
+		{r.Toe, r.Cic, r.Omega0, r.Cis},
+		{r.I0, r.Crc, r.Omega, r.OmegaDot},
+		{r.IDot, r.CodesL2, r.WeekNum, r.L2PFlag},
+		{r.SVAccuracy, r.SVHealth, r.TGD, r.IODC},
+		{r.TransmissionTime, r.FitInterval, 0, 0},
+	}
+	for _, f := range lines {
+		if err := nw.writeDataLine(f[0], f[1], f[2], f[3]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteGlonass writes one GLONASS record as a 4-line block: the
+// epoch/clock line followed by 3 lines of position/velocity/acceleration
+// plus health, frequency channel and age-of-operation.
+func (nw *Writer) WriteGlonass(r GlonassRecord) error {
+	satID := fmt.Sprintf("R%02d", r.PRN)
+	if err := nw.writeEpochLine(satID, r.Toc, r.ClockBias, r.RelFreqBias, r.MsgFrameTime); err != nil {
+		return err
+	}
+
+	lines := [3][4]float64{
+		{r.X, r.VelX, r.AccelX, r.Health},
+		{r.Y, r.VelY, r.AccelY, r.FreqNum},
+		{r.Z, r.VelZ, r.AccelZ, r.AgeOp},
+	}
+	for _, f := range lines {
+		if err := nw.writeDataLine(f[0], f[1], f[2], f[3]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush flushes any buffered output to the underlying writer.
+func (nw *Writer) Flush() error { return nw.w.Flush() }
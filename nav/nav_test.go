@@ -0,0 +1,78 @@
+package nav
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHeaderIncludesIonoAndTimeSysLines(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	gen := time.Date(2026, 7, 26, 0, 0, 0, 0, time.UTC)
+	iono := []IonoCorr{{Type: "GPSA", Coeffs: [4]float64{1, 2, 3, 4}}}
+	timeSys := []TimeSystemCorr{{Type: "GPUT", A0: 1.5, A1: 2.5, RefTime: 61440, RefWeek: 2200}}
+	if err := w.WriteHeader(iono, timeSys, gen); err != nil {
+		t.Fatalf("WriteHeader: %v", err)
+	}
+	w.Flush()
+
+	out := buf.String()
+	if !strings.Contains(out, "GPSA") || !strings.Contains(out, "IONOSPHERIC CORR") {
+		t.Fatalf("expected an IONOSPHERIC CORR line for GPSA, got:\n%s", out)
+	}
+	if !strings.Contains(out, "GPUT") || !strings.Contains(out, "TIME SYSTEM CORR") {
+		t.Fatalf("expected a TIME SYSTEM CORR line for GPUT, got:\n%s", out)
+	}
+	if !strings.Contains(out, "END OF HEADER") {
+		t.Fatalf("expected an END OF HEADER line, got:\n%s", out)
+	}
+}
+
+func TestWriteKeplerianProducesEightLines(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	r := KeplerianRecord{Sys: 'G', PRN: 1, Toc: time.Date(2026, 7, 26, 0, 0, 0, 0, time.UTC)}
+	if err := w.WriteKeplerian(r); err != nil {
+		t.Fatalf("WriteKeplerian: %v", err)
+	}
+	w.Flush()
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 8 {
+		t.Fatalf("expected 8 lines for a Keplerian record, got %d:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "G01 ") {
+		t.Fatalf("expected the epoch line to start with the 4-char satellite ID, got %q", lines[0])
+	}
+}
+
+func TestWriteGlonassProducesFourLines(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	r := GlonassRecord{PRN: 2, Toc: time.Date(2026, 7, 26, 0, 0, 0, 0, time.UTC)}
+	if err := w.WriteGlonass(r); err != nil {
+		t.Fatalf("WriteGlonass: %v", err)
+	}
+	w.Flush()
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines for a GLONASS record, got %d:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "R02 ") {
+		t.Fatalf("expected the epoch line to start with the 4-char satellite ID, got %q", lines[0])
+	}
+}
+
+func TestExp19FieldWidth(t *testing.T) {
+	for _, v := range []float64{1.234567890123e-04, -1.234567890123e-11, 0} {
+		if got := len(exp19(v)); got != 19 {
+			t.Fatalf("exp19(%v) = %q, width %d, want 19", v, exp19(v), got)
+		}
+	}
+}
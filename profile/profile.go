@@ -0,0 +1,162 @@
+// Package profile describes how a GNSS JSON dump's fields map onto RINEX
+// 3 SYS / # / OBS TYPES entries, so the converter isn't locked to one
+// receiver's signal plan. A Profile is loaded from a YAML or JSON file
+// (picked by file extension); Default returns the built-in profile that
+// reproduces this tool's original u-blox-oriented hard-coded behavior.
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ObsPrefixes gives the JSON field-name prefix used for each observable
+// kind (e.g. "prMes_" for code).
+type ObsPrefixes struct {
+	Code    string `yaml:"code" json:"code"`
+	Phase   string `yaml:"phase" json:"phase"`
+	Doppler string `yaml:"doppler" json:"doppler"`
+	SNR     string `yaml:"snr" json:"snr"`
+}
+
+// SystemDef is one constellation's band / obs-code / JSON-prefix mapping.
+type SystemDef struct {
+	// DataSys is the JSON key-suffix system letter, e.g. "B" for BeiDou
+	// displayed as "C", or "Q" for QZSS displayed as "J". Defaults to the
+	// display system letter when empty.
+	DataSys string `yaml:"dataSys,omitempty" json:"dataSys,omitempty"`
+
+	// Bands lists the bands in print order, e.g. ["1", "2"].
+	Bands []string `yaml:"bands" json:"bands"`
+
+	// ObsCodes gives the ordered RINEX C/L/D/S codes for each band in
+	// Bands, e.g. {"1": ["C1C", "L1C", "D1C", "S1C"]}.
+	ObsCodes map[string][]string `yaml:"obsCodes" json:"obsCodes"`
+
+	Prefixes ObsPrefixes `yaml:"prefixes" json:"prefixes"`
+}
+
+// Profile declares, per displayed RINEX constellation letter, how to read
+// a GNSS JSON dump's fields into RINEX 3 observation records.
+type Profile struct {
+	Name string `yaml:"name" json:"name"`
+
+	// Order lists display-system letters (e.g. "G", "R") in the order
+	// they should appear in the header and body.
+	Order []string `yaml:"order" json:"order"`
+
+	Systems map[string]SystemDef `yaml:"systems" json:"systems"`
+}
+
+// ObsTypes returns the flat, ordered list of RINEX obs codes for a
+// system, i.e. ObsCodes[Bands[0]] followed by ObsCodes[Bands[1]], etc. —
+// the same shape fixedSysObsTypes used to return per system.
+func (sd SystemDef) ObsTypes() []string {
+	var types []string
+	for _, band := range sd.Bands {
+		types = append(types, sd.ObsCodes[band]...)
+	}
+	return types
+}
+
+// DataSysRune returns the JSON key-suffix system rune for display system
+// disp, falling back to disp itself when the profile doesn't override it.
+func (sd SystemDef) DataSysRune(disp rune) rune {
+	if sd.DataSys == "" {
+		return disp
+	}
+	return rune(sd.DataSys[0])
+}
+
+// Default returns the built-in "ublox-basic" profile, matching the
+// signal plan this tool originally had hard-coded.
+func Default() Profile {
+	return Profile{
+		Name:  "ublox-basic",
+		Order: []string{"G", "R", "E", "C", "J"},
+		Systems: map[string]SystemDef{
+			"G": {
+				Bands: []string{"1", "2"},
+				ObsCodes: map[string][]string{
+					"1": {"C1C", "L1C", "D1C", "S1C"},
+					"2": {"C2C", "L2C", "D2C", "S2C"},
+				},
+				Prefixes: ObsPrefixes{Code: "prMes_", Phase: "cpMes_", Doppler: "doMes_", SNR: "cn0_"},
+			},
+			"R": {
+				Bands: []string{"1", "2"},
+				ObsCodes: map[string][]string{
+					"1": {"C1C", "L1C", "D1C", "S1C"},
+					"2": {"C2C", "L2C", "D2C", "S2C"},
+				},
+				Prefixes: ObsPrefixes{Code: "prMes_", Phase: "cpMes_", Doppler: "doMes_", SNR: "cn0_"},
+			},
+			"E": {
+				Bands: []string{"1", "7"},
+				ObsCodes: map[string][]string{
+					"1": {"C1X", "L1X", "D1X", "S1X"},
+					"7": {"C7X", "L7X", "D7X", "S7X"},
+				},
+				Prefixes: ObsPrefixes{Code: "prMes_", Phase: "cpMes_", Doppler: "doMes_", SNR: "cn0_"},
+			},
+			// BeiDou is printed as "C" but its JSON fields are suffixed "B".
+			"C": {
+				DataSys: "B",
+				Bands:   []string{"2", "7"},
+				ObsCodes: map[string][]string{
+					"2": {"C2X", "L2X", "D2X", "S2X"},
+					"7": {"C7X", "L7X", "D7X", "S7X"},
+				},
+				Prefixes: ObsPrefixes{Code: "prMes_", Phase: "cpMes_", Doppler: "doMes_", SNR: "cn0_"},
+			},
+			// QZSS is printed as "J" but its JSON fields are suffixed "Q".
+			"J": {
+				DataSys: "Q",
+				Bands:   []string{"1", "2"},
+				ObsCodes: map[string][]string{
+					"1": {"C1C", "L1C", "D1C", "S1C"},
+					"2": {"C2X", "L2X", "D2X", "S2X"},
+				},
+				Prefixes: ObsPrefixes{Code: "prMes_", Phase: "cpMes_", Doppler: "doMes_", SNR: "cn0_"},
+			},
+		},
+	}
+}
+
+// Load reads a Profile from path, choosing a YAML or JSON decoder based
+// on its extension (.yaml/.yml vs .json).
+func Load(path string) (Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Profile{}, fmt.Errorf("read profile %s: %w", path, err)
+	}
+
+	var p Profile
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &p); err != nil {
+			return Profile{}, fmt.Errorf("parse YAML profile %s: %w", path, err)
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &p); err != nil {
+			return Profile{}, fmt.Errorf("parse JSON profile %s: %w", path, err)
+		}
+	default:
+		return Profile{}, fmt.Errorf("profile %s: unrecognized extension %q (want .yaml, .yml or .json)", path, ext)
+	}
+
+	if len(p.Order) == 0 {
+		return Profile{}, fmt.Errorf("profile %s: %q is empty", path, "order")
+	}
+	for _, disp := range p.Order {
+		if _, ok := p.Systems[disp]; !ok {
+			return Profile{}, fmt.Errorf("profile %s: system %q listed in order but missing from systems", path, disp)
+		}
+	}
+	return p, nil
+}
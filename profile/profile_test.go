@@ -0,0 +1,88 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultObsTypes(t *testing.T) {
+	p := Default()
+	got := p.Systems["G"].ObsTypes()
+	want := []string{"C1C", "L1C", "D1C", "S1C", "C2C", "L2C", "D2C", "S2C"}
+	if len(got) != len(want) {
+		t.Fatalf("ObsTypes() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("ObsTypes()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDefaultDataSysRuneFallsBackToDisplay(t *testing.T) {
+	p := Default()
+	if r := p.Systems["G"].DataSysRune('G'); r != 'G' {
+		t.Fatalf("GPS data sys = %q, want 'G'", r)
+	}
+	if r := p.Systems["C"].DataSysRune('C'); r != 'B' {
+		t.Fatalf("BeiDou data sys = %q, want 'B'", r)
+	}
+}
+
+func TestLoadYAMLAndJSONAgree(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "p.yaml")
+	if err := os.WriteFile(yamlPath, []byte(`
+name: test
+order: [G]
+systems:
+  G:
+    bands: ["1"]
+    obsCodes:
+      "1": [C1C, L1C, D1C, S1C]
+    prefixes: {code: prMes_, phase: cpMes_, doppler: doMes_, snr: cn0_}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonPath := filepath.Join(dir, "p.json")
+	if err := os.WriteFile(jsonPath, []byte(`{
+		"name": "test",
+		"order": ["G"],
+		"systems": {
+			"G": {
+				"bands": ["1"],
+				"obsCodes": {"1": ["C1C", "L1C", "D1C", "S1C"]},
+				"prefixes": {"code": "prMes_", "phase": "cpMes_", "doppler": "doMes_", "snr": "cn0_"}
+			}
+		}
+	}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	py, err := Load(yamlPath)
+	if err != nil {
+		t.Fatalf("Load(yaml): %v", err)
+	}
+	pj, err := Load(jsonPath)
+	if err != nil {
+		t.Fatalf("Load(json): %v", err)
+	}
+
+	if got, want := py.Systems["G"].ObsTypes(), pj.Systems["G"].ObsTypes(); len(got) != len(want) {
+		t.Fatalf("YAML and JSON profiles disagree: %v vs %v", got, want)
+	}
+}
+
+func TestLoadRejectsOrderSystemMismatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(path, []byte(`{"name":"bad","order":["G","R"],"systems":{"G":{"bands":["1"],"obsCodes":{"1":["C1C","L1C","D1C","S1C"]},"prefixes":{"code":"prMes_","phase":"cpMes_","doppler":"doMes_","snr":"cn0_"}}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatalf("expected Load to reject an order entry missing from systems")
+	}
+}